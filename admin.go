@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AdminServer exposes the Defender's state over HTTP for out-of-band
+// incident response (listing/inspecting/banning/unbanning IPs). It is
+// intended to be served on its own port, away from the public listener, so
+// it is never itself subject to the public rate limiter.
+type AdminServer struct {
+	defender *Defender
+	token    string
+	mux      *http.ServeMux
+}
+
+// NewAdminServer builds an AdminServer gated by a bearer token; requests
+// without a matching "Authorization: Bearer <token>" header are rejected.
+func NewAdminServer(defender *Defender, token string) *AdminServer {
+	a := &AdminServer{defender: defender, token: token, mux: http.NewServeMux()}
+	a.mux.HandleFunc("GET /defender/banned", a.handleListBanned)
+	a.mux.HandleFunc("GET /defender/hosts/{ip}", a.handleGetHost)
+	a.mux.HandleFunc("POST /defender/unban", a.handleUnban)
+	a.mux.HandleFunc("POST /defender/ban", a.handleBan)
+	return a
+}
+
+// ServeHTTP implements http.Handler, checking the bearer token before
+// dispatching to the underlying mux.
+func (a *AdminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *AdminServer) authorized(r *http.Request) bool {
+	// An empty token means the admin API was never configured with one; it
+	// must reject every request rather than let an empty-vs-empty comparison
+	// authorize them.
+	if a.token == "" {
+		return false
+	}
+
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	presented := strings.TrimPrefix(auth, prefix)
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(a.token)) == 1
+}
+
+// bannedEntry is the JSON shape returned by GET /defender/banned.
+type bannedEntry struct {
+	IP        string    `json:"ip"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (a *AdminServer) handleListBanned(w http.ResponseWriter, r *http.Request) {
+	banned := a.defender.Banned()
+	entries := make([]bannedEntry, 0, len(banned))
+	for ip, expiry := range banned {
+		entries = append(entries, bannedEntry{IP: ip, ExpiresAt: expiry})
+	}
+	writeJSON(w, entries)
+}
+
+// hostResponse is the JSON shape returned by GET /defender/hosts/{ip}.
+type hostResponse struct {
+	IP             string      `json:"ip"`
+	Score          int         `json:"score"`
+	Offenses       int         `json:"offenses"`
+	Banned         bool        `json:"banned"`
+	BanExpiresAt   *time.Time  `json:"ban_expires_at,omitempty"`
+	RecentRequests []time.Time `json:"recent_requests"`
+}
+
+func (a *AdminServer) handleGetHost(w http.ResponseWriter, r *http.Request) {
+	ip := r.PathValue("ip")
+	info, ok := a.defender.Host(ip)
+	if !ok {
+		http.Error(w, "No such host", http.StatusNotFound)
+		return
+	}
+
+	resp := hostResponse{
+		IP:             ip,
+		Score:          info.Score,
+		Offenses:       info.Offenses,
+		Banned:         info.Banned,
+		RecentRequests: info.RecentRequests,
+	}
+	if info.Banned {
+		resp.BanExpiresAt = &info.BanUntil
+	}
+	writeJSON(w, resp)
+}
+
+// unbanRequest is the JSON body accepted by POST /defender/unban. IP accepts
+// either a bare address or a CIDR such as "203.0.113.0/24".
+type unbanRequest struct {
+	IP string `json:"ip"`
+}
+
+func (a *AdminServer) handleUnban(w http.ResponseWriter, r *http.Request) {
+	var req unbanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.IP == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := a.defender.Unban(req.IP); err != nil {
+		http.Error(w, "Invalid ip/cidr: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// banRequest is the JSON body accepted by POST /defender/ban. IP accepts
+// either a bare address or a CIDR such as "203.0.113.0/24".
+type banRequest struct {
+	IP       string        `json:"ip"`
+	Duration time.Duration `json:"duration"`
+}
+
+func (a *AdminServer) handleBan(w http.ResponseWriter, r *http.Request) {
+	var req banRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.IP == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Duration <= 0 {
+		req.Duration = banEscalation[0]
+	}
+	if err := a.defender.Ban(req.IP, req.Duration); err != nil {
+		http.Error(w, "Invalid ip/cidr: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType identifies a kind of suspicious behavior that contributes to an
+// IP's abuse score.
+type EventType string
+
+const (
+	EventRateViolation EventType = "rate_violation"
+	Event404           EventType = "not_found"
+	EventMalformedBody EventType = "malformed_body"
+	EventOversizedBody EventType = "oversized_body"
+)
+
+// eventScore is the number of points a single occurrence of an event type
+// adds to an IP's score.
+var eventScore = map[EventType]int{
+	EventRateViolation: 10,
+	Event404:           2,
+	EventMalformedBody: 5,
+	EventOversizedBody: 8,
+}
+
+// banThreshold is the score at which an IP crosses from merely suspicious to banned.
+const banThreshold = 20
+
+// scoreDecayInterval/scoreDecayAmount control how quickly a host's score
+// recovers once it stops generating events.
+const (
+	scoreDecayInterval = time.Minute
+	scoreDecayAmount   = 1
+)
+
+// maxRecentRequests bounds how much per-host request history is kept for the admin API.
+const maxRecentRequests = 20
+
+// banEscalation lists the ban duration applied on the Nth offense (index 0 is
+// the first ban). The last entry repeats for every offense past the end of
+// the list.
+var banEscalation = []time.Duration{
+	1 * time.Minute,
+	10 * time.Minute,
+	1 * time.Hour,
+	24 * time.Hour,
+}
+
+// banCacheRefreshInterval bounds how stale the in-memory ban cache can get
+// between explicit invalidations (a Ban/Unban call refreshes it immediately).
+const banCacheRefreshInterval = 2 * time.Second
+
+// banCacheEntry is one row of the in-memory ban cache: a banned prefix and
+// when its ban expires.
+type banCacheEntry struct {
+	prefix netip.Prefix
+	expiry time.Time
+}
+
+// Defender is a scoring-based replacement for the old binary banlist: each
+// suspicious event adds points to an IP's score, and once the score crosses
+// banThreshold the IP is banned for an escalating duration. Scores decay over
+// time so an IP that stops misbehaving is eventually forgiven. All state is
+// delegated to a Store, so the backend can be swapped between in-memory,
+// on-disk, and Redis without touching this logic.
+//
+// findBan - called on every request - needs the full set of banned prefixes
+// to do a longest-prefix match, so it's kept in an in-memory cache instead of
+// re-querying the store (a Redis round trip per banned entry, per request)
+// each time. The cache is refreshed periodically and invalidated immediately
+// by Ban/Unban/ban, so a ban is visible right away rather than after the
+// next refresh tick.
+type Defender struct {
+	store Store
+
+	cacheMu sync.RWMutex
+	cache   []banCacheEntry
+
+	// banLocks serializes the check-then-ban decision in AddEvent per host
+	// key, so concurrent requests from the same attacker that all cross
+	// banThreshold at once can't all observe "not yet banned" and race on
+	// ban(), double-escalating the ban schedule.
+	banLocks sync.Map // key -> *sync.Mutex
+}
+
+// NewDefender wraps store in scoring/escalation logic and starts the
+// background score-decay and ban-cache-refresh loops.
+func NewDefender(store Store) *Defender {
+	d := &Defender{store: store}
+	d.refreshBanCache()
+	go d.decayLoop()
+	go d.refreshBanCacheLoop()
+	return d
+}
+
+// refreshBanCacheLoop periodically rebuilds the ban cache from the store, so
+// a ban applied directly through the store (or by another node sharing a
+// Redis-backed store) is eventually picked up even without a local Ban call.
+func (d *Defender) refreshBanCacheLoop() {
+	for {
+		time.Sleep(banCacheRefreshInterval)
+		d.refreshBanCache()
+	}
+}
+
+// refreshBanCache rebuilds the in-memory ban cache from the store, sorted by
+// prefix length descending so findBan can stop at its first match.
+func (d *Defender) refreshBanCache() {
+	banned, err := d.store.BannedIPs()
+	if err != nil {
+		return
+	}
+
+	cache := make([]banCacheEntry, 0, len(banned))
+	for key, expiry := range banned {
+		prefix, err := netip.ParsePrefix(key)
+		if err != nil {
+			continue
+		}
+		cache = append(cache, banCacheEntry{prefix: prefix, expiry: expiry})
+	}
+	sort.Slice(cache, func(i, j int) bool { return cache[i].prefix.Bits() > cache[j].prefix.Bits() })
+
+	d.cacheMu.Lock()
+	d.cache = cache
+	d.cacheMu.Unlock()
+}
+
+// singleHostKey returns the store key used to track per-IP score/ban state:
+// ip expressed as a single-address prefix (a /32 or /128). Using a prefix
+// here, rather than the bare address, lets it live in the same keyspace as
+// operator-entered CIDR bans so findBan can do one longest-prefix scan over
+// both.
+func singleHostKey(ip string) (string, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()).String(), true
+}
+
+// normalizeBanKey accepts either a bare IP or a CIDR and returns it as a
+// netip.Prefix, so operators can ban a single address or an entire subnet
+// through the same API.
+func normalizeBanKey(ipOrCIDR string) (netip.Prefix, error) {
+	if strings.Contains(ipOrCIDR, "/") {
+		return netip.ParsePrefix(ipOrCIDR)
+	}
+	addr, err := netip.ParseAddr(ipOrCIDR)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// looksMisattributed guards against banning an IP that a spoofed or
+// misconfigured X-Forwarded-For header could point at every client: once
+// we're behind a trusted proxy, a loopback or private address reaching here
+// as the "client IP" is a sign the header chain is broken, not a real
+// attacker, and banning it would lock out everyone behind that proxy.
+func looksMisattributed(addr netip.Addr) bool {
+	return len(trustedProxies) > 0 && (addr.IsLoopback() || addr.IsPrivate())
+}
+
+// hostLock returns the mutex used to serialize the check-then-ban decision
+// for key, creating it on first use.
+func (d *Defender) hostLock(key string) *sync.Mutex {
+	l, _ := d.banLocks.LoadOrStore(key, &sync.Mutex{})
+	return l.(*sync.Mutex)
+}
+
+// AddEvent records a suspicious event for ip, banning it if its score has
+// crossed banThreshold, and reports whether the IP is now banned.
+func (d *Defender) AddEvent(ip string, event EventType) bool {
+	key, ok := singleHostKey(ip)
+	if !ok {
+		key = ip
+	}
+
+	score, err := d.store.AddScore(key, eventScore[event])
+	if err != nil {
+		return false
+	}
+
+	if score >= banThreshold {
+		lock := d.hostLock(key)
+		lock.Lock()
+		if _, banned := d.findBan(ip); !banned {
+			d.ban(ip, key)
+		}
+		lock.Unlock()
+	}
+	_, banned := d.findBan(ip)
+	return banned
+}
+
+// ban escalates ip's ban duration based on how many times it has already
+// offended. key is ip's store key, already resolved by the caller.
+func (d *Defender) ban(ip, key string) {
+	addr, err := netip.ParseAddr(ip)
+	if err == nil && looksMisattributed(addr) {
+		return
+	}
+
+	offenses, _ := d.store.GetOffenses(key)
+	idx := offenses
+	if idx >= len(banEscalation) {
+		idx = len(banEscalation) - 1
+	}
+	d.store.Ban(key, time.Now().Add(banEscalation[idx]))
+	d.store.IncrementOffenses(key)
+	d.store.SetScore(key, 0)
+	d.refreshBanCache()
+}
+
+// Ban manually bans ipOrCIDR - a bare address or a subnet such as
+// "203.0.113.0/24" - for duration, e.g. from an admin API call.
+func (d *Defender) Ban(ipOrCIDR string, duration time.Duration) error {
+	prefix, err := normalizeBanKey(ipOrCIDR)
+	if err != nil {
+		return err
+	}
+	if err := d.store.Ban(prefix.String(), time.Now().Add(duration)); err != nil {
+		return err
+	}
+	d.refreshBanCache()
+	return nil
+}
+
+// Unban clears the ban recorded under ipOrCIDR and resets its score, for
+// operators doing incident response. It only clears an exact match; an IP
+// banned only by virtue of a broader subnet ban needs that subnet unbanned.
+func (d *Defender) Unban(ipOrCIDR string) error {
+	prefix, err := normalizeBanKey(ipOrCIDR)
+	if err != nil {
+		return err
+	}
+	if err := d.store.Unban(prefix.String()); err != nil {
+		return err
+	}
+	d.refreshBanCache()
+	return nil
+}
+
+// findBan reports whether ip is covered by any banned prefix, and if so the
+// expiry of the most specific (longest-prefix) match. It's called on every
+// request, so it scans the in-memory ban cache rather than the store.
+func (d *Defender) findBan(ip string) (time.Time, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	now := time.Now()
+	d.cacheMu.RLock()
+	defer d.cacheMu.RUnlock()
+	// Sorted by prefix length descending, so the first (and most specific)
+	// containing, unexpired entry is the longest-prefix match.
+	for _, entry := range d.cache {
+		if now.After(entry.expiry) {
+			continue
+		}
+		if entry.prefix.Contains(addr) {
+			return entry.expiry, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// IsBanned reports whether ip is covered by a currently active ban, whether
+// on its own address or on a subnet containing it.
+func (d *Defender) IsBanned(ip string) bool {
+	_, banned := d.findBan(ip)
+	return banned
+}
+
+// GetScore returns ip's current abuse score.
+func (d *Defender) GetScore(ip string) int {
+	key, ok := singleHostKey(ip)
+	if !ok {
+		key = ip
+	}
+	score, _ := d.store.GetScore(key)
+	return score
+}
+
+// GetBanTime returns the time at which ip's ban expires and whether it is
+// currently banned, considering both per-address and subnet bans.
+func (d *Defender) GetBanTime(ip string) (time.Time, bool) {
+	return d.findBan(ip)
+}
+
+// RecordRequest appends t to ip's recent request history, used by the admin
+// API to show what a host has been doing.
+func (d *Defender) RecordRequest(ip string, t time.Time) {
+	key, ok := singleHostKey(ip)
+	if !ok {
+		key = ip
+	}
+	d.store.RecordRequest(key, t)
+}
+
+// HostInfo is a snapshot of a host's abuse state, used by the admin API.
+type HostInfo struct {
+	Score          int
+	Offenses       int
+	BanUntil       time.Time
+	Banned         bool
+	RecentRequests []time.Time
+}
+
+// Host returns a snapshot of ip's abuse state, and whether anything is known
+// about it at all.
+func (d *Defender) Host(ip string) (HostInfo, bool) {
+	key, ok := singleHostKey(ip)
+	if !ok {
+		key = ip
+	}
+
+	score, err := d.store.GetScore(key)
+	if err != nil {
+		return HostInfo{}, false
+	}
+	offenses, _ := d.store.GetOffenses(key)
+	recent, _ := d.store.RecentRequests(key)
+	banUntil, banned := d.findBan(ip)
+	if score == 0 && offenses == 0 && !banned && len(recent) == 0 {
+		return HostInfo{}, false
+	}
+	return HostInfo{Score: score, Offenses: offenses, BanUntil: banUntil, Banned: banned, RecentRequests: recent}, true
+}
+
+// Banned returns the ban expiry time of every IP or subnet currently serving
+// a ban, keyed by its CIDR (a plain IP is reported as a /32 or /128).
+func (d *Defender) Banned() map[string]time.Time {
+	banned, err := d.store.BannedIPs()
+	if err != nil {
+		return map[string]time.Time{}
+	}
+	return banned
+}
+
+// decayLoop periodically reduces every tracked host's score, so abuse that
+// has stopped is eventually forgiven instead of banning forever. A host
+// whose score has fully decayed and that has no offense history or active
+// ban left is forgotten entirely, so a store doesn't keep one record per IP
+// ever seen for the life of the process.
+func (d *Defender) decayLoop() {
+	for {
+		time.Sleep(scoreDecayInterval)
+		ips, err := d.store.TrackedIPs()
+		if err != nil {
+			continue
+		}
+		for _, ip := range ips {
+			score, err := d.store.GetScore(ip)
+			if err != nil {
+				continue
+			}
+			if score <= 0 {
+				d.forgetIfQuiet(ip)
+				continue
+			}
+			newScore := score - scoreDecayAmount
+			if newScore < 0 {
+				newScore = 0
+			}
+			d.store.SetScore(ip, newScore)
+			if newScore == 0 {
+				d.forgetIfQuiet(ip)
+			}
+		}
+	}
+}
+
+// forgetIfQuiet discards ip's store record if it has no offense history and
+// no active ban, so a fully-decayed host doesn't linger forever.
+func (d *Defender) forgetIfQuiet(ip string) {
+	offenses, err := d.store.GetOffenses(ip)
+	if err != nil || offenses > 0 {
+		return
+	}
+	if banned, err := d.store.IsBanned(ip); err != nil || banned {
+		return
+	}
+	d.store.Forget(ip)
+	d.banLocks.Delete(ip)
+}
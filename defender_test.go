@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDefenderBanEscalation(t *testing.T) {
+	tests := []struct {
+		name          string
+		priorOffenses int
+		wantStep      time.Duration // the banEscalation entry this offense count should use
+	}{
+		{name: "first offense uses the first escalation step", priorOffenses: 0, wantStep: banEscalation[0]},
+		{name: "second offense uses the second escalation step", priorOffenses: 1, wantStep: banEscalation[1]},
+		{name: "fourth offense uses the last escalation step", priorOffenses: 3, wantStep: banEscalation[3]},
+		{name: "offenses past the list repeat the last step", priorOffenses: 10, wantStep: banEscalation[len(banEscalation)-1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			const key = "198.51.100.1/32"
+			for i := 0; i < tt.priorOffenses; i++ {
+				store.IncrementOffenses(key)
+			}
+
+			d := NewDefender(store)
+			before := time.Now()
+			d.ban("198.51.100.1", key)
+
+			expiry, found, err := store.BanExpiry(key)
+			if err != nil {
+				t.Fatalf("BanExpiry(%q) error: %v", key, err)
+			}
+			if !found {
+				t.Fatal("expected a ban to be recorded")
+			}
+
+			wantExpiry := before.Add(tt.wantStep)
+			if diff := expiry.Sub(wantExpiry); diff < -time.Second || diff > time.Second {
+				t.Errorf("ban expiry = %v, want approximately %v (step %v)", expiry, wantExpiry, tt.wantStep)
+			}
+		})
+	}
+}
+
+func TestDefenderBanSkipsMisattributedAddress(t *testing.T) {
+	savedProxies := trustedProxies
+	defer func() { trustedProxies = savedProxies }()
+	trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	store := NewMemoryStore()
+	d := NewDefender(store)
+	d.ban("127.0.0.1", "127.0.0.1/32")
+
+	if _, found, _ := store.BanExpiry("127.0.0.1/32"); found {
+		t.Error("expected a loopback address to be treated as misattributed and not banned, once trusted proxies are configured")
+	}
+}
+
+// TestDefenderAddEventSerializesBanDecision guards against a check-then-act
+// race: many concurrent requests from one attacker all crossing banThreshold
+// at once must record exactly one offense, not one per racing goroutine.
+func TestDefenderAddEventSerializesBanDecision(t *testing.T) {
+	store := NewMemoryStore()
+	const key = "198.51.100.1/32"
+	store.SetScore(key, banThreshold)
+
+	d := NewDefender(store)
+
+	const goroutines = 100
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer wg.Done()
+			d.AddEvent("198.51.100.1", EventRateViolation)
+		}()
+	}
+	wg.Wait()
+
+	offenses, err := store.GetOffenses(key)
+	if err != nil {
+		t.Fatalf("GetOffenses(%q) error: %v", key, err)
+	}
+	if offenses != 1 {
+		t.Errorf("offenses = %d, want exactly 1 for a single ban-worthy incident", offenses)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// trustedProxies lists the reverse-proxy subnets allowed to set
+// X-Forwarded-For, configured from --trusted-proxies in main(). An empty
+// list means the server is reachable directly and X-Forwarded-For is never
+// trusted.
+var trustedProxies []netip.Prefix
+
+// isTrustedProxy reports whether addr falls inside one of the configured
+// trusted-proxy prefixes.
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// getIP resolves the real client IP for r. If the direct peer (RemoteAddr)
+// isn't a trusted proxy, X-Forwarded-For is ignored outright - an attacker
+// connecting straight to us can put anything in that header. Otherwise the
+// chain is walked right-to-left, stopping at the first hop that isn't itself
+// a trusted proxy, matching the well-known Nginx/Traefik semantics: the
+// right-most untrusted entry is the one no proxy in our chain could have
+// forged.
+func getIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+
+	if len(trustedProxies) == 0 || !isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	chain := r.Header.Get("X-Forwarded-For")
+	hops := strings.Split(chain, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			continue
+		}
+		if !isTrustedProxy(hop) {
+			return hop.String()
+		}
+	}
+	// Every hop (or the header itself) was unusable; fall back to the
+	// directly-connected peer rather than trusting nothing at all.
+	return remote.String()
+}
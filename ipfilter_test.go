@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+func TestGetIP(t *testing.T) {
+	savedProxies := trustedProxies
+	defer func() { trustedProxies = savedProxies }()
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   string
+		want           string
+	}{
+		{
+			name:         "no trusted proxies ignores X-Forwarded-For",
+			remoteAddr:   "203.0.113.5:1234",
+			forwardedFor: "198.51.100.9",
+			want:         "203.0.113.5",
+		},
+		{
+			name:           "untrusted peer ignores X-Forwarded-For",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "203.0.113.5:1234",
+			forwardedFor:   "198.51.100.9",
+			want:           "203.0.113.5",
+		},
+		{
+			name:           "trusted peer walks chain to first untrusted hop",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedFor:   "198.51.100.9, 10.0.0.2",
+			want:           "198.51.100.9",
+		},
+		{
+			name:           "trusted peer with fully trusted chain falls back to peer",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedFor:   "10.0.0.3, 10.0.0.2",
+			want:           "10.0.0.1",
+		},
+		{
+			name:           "trusted peer with unparseable header falls back to peer",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedFor:   "not-an-ip",
+			want:           "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trustedProxies = nil
+			for _, cidr := range tt.trustedProxies {
+				trustedProxies = append(trustedProxies, netip.MustParsePrefix(cidr))
+			}
+
+			r := &http.Request{RemoteAddr: tt.remoteAddr, Header: http.Header{}}
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+
+			if got := getIP(r); got != tt.want {
+				t.Errorf("getIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefenderFindBanLongestPrefix(t *testing.T) {
+	d := NewDefender(NewMemoryStore())
+
+	if err := d.Ban("203.0.113.0/24", banEscalation[0]); err != nil {
+		t.Fatalf("Ban(subnet) failed: %v", err)
+	}
+	if err := d.Ban("203.0.113.9", banEscalation[0]); err != nil {
+		t.Fatalf("Ban(single host) failed: %v", err)
+	}
+
+	if !d.IsBanned("203.0.113.9") {
+		t.Fatal("expected 203.0.113.9 to be banned")
+	}
+	if !d.IsBanned("203.0.113.50") {
+		t.Fatal("expected 203.0.113.50 to be banned via the /24 subnet ban")
+	}
+	if d.IsBanned("198.51.100.1") {
+		t.Fatal("expected unrelated IP not to be banned")
+	}
+
+	if err := d.Unban("203.0.113.9"); err != nil {
+		t.Fatalf("Unban(single host) failed: %v", err)
+	}
+	if !d.IsBanned("203.0.113.9") {
+		t.Fatal("expected 203.0.113.9 to still be banned via the /24 subnet ban after unbanning the /32")
+	}
+}
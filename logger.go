@@ -0,0 +1,193 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LogRecord is one structured log line emitted per request.
+type LogRecord struct {
+	IP        string    `json:"ip"`
+	Timestamp time.Time `json:"timestamp"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	BodySize  int       `json:"body_size"`
+	UserAgent string    `json:"user_agent"`
+	Score     int       `json:"score"`
+	Banned    bool      `json:"banned"`
+	Body      string    `json:"body,omitempty"`
+}
+
+// logChannelBuffer bounds how many records can queue before Log starts
+// dropping them instead of blocking the request path.
+const logChannelBuffer = 1024
+
+// Logger is an async, structured (one JSON object per line) request logger.
+// Records are handed off to a buffered channel and written by a single
+// background goroutine, so a flood of requests never serializes on file I/O
+// in the hot path the way the old open-write-close-per-request logging did.
+// The active file is rotated once it passes maxFileSize; rotated files are
+// gzip-compressed and pruned down to maxBackups.
+type Logger struct {
+	records     chan LogRecord
+	path        string
+	maxBodySize int
+	maxFileSize int64
+	maxBackups  int
+
+	mu      sync.Mutex
+	file    *os.File
+	written int64
+	done    chan struct{}
+}
+
+// NewLogger creates a Logger writing to path, rotating once the active file
+// passes maxFileSize and keeping at most maxBackups compressed generations.
+// Bodies longer than maxBodySize are redacted before they're logged, so a
+// client can't blow up disk usage by posting huge payloads.
+func NewLogger(path string, maxFileSize int64, maxBackups, maxBodySize int) (*Logger, error) {
+	l := &Logger{
+		records:     make(chan LogRecord, logChannelBuffer),
+		path:        path,
+		maxBodySize: maxBodySize,
+		maxFileSize: maxFileSize,
+		maxBackups:  maxBackups,
+		done:        make(chan struct{}),
+	}
+	if err := l.openCurrent(); err != nil {
+		return nil, err
+	}
+	go l.run()
+	return l, nil
+}
+
+func (l *Logger) openCurrent() error {
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file = f
+	l.written = info.Size()
+	return nil
+}
+
+// Log enqueues rec for writing, redacting its body if it's past maxBodySize.
+func (l *Logger) Log(rec LogRecord) {
+	if len(rec.Body) > l.maxBodySize {
+		rec.Body = fmt.Sprintf("<redacted %d bytes>", len(rec.Body))
+	}
+	select {
+	case l.records <- rec:
+	default:
+		// The buffer is full, most likely because we're under attack right
+		// now; drop the record rather than block the request path on disk I/O.
+		fmt.Println("Log buffer full, dropping record for", rec.IP)
+	}
+}
+
+func (l *Logger) run() {
+	for rec := range l.records {
+		l.write(rec)
+	}
+	close(l.done)
+}
+
+func (l *Logger) write(rec LogRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		fmt.Println("Error encoding log record:", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.written+int64(len(line)) > l.maxFileSize {
+		if err := l.rotate(); err != nil {
+			fmt.Println("Error rotating log file:", err)
+		}
+	}
+
+	n, err := l.file.Write(line)
+	if err != nil {
+		fmt.Println("Error writing log file:", err)
+		return
+	}
+	l.written += int64(n)
+}
+
+// rotate closes the current file, compresses it alongside a timestamp
+// suffix, opens a fresh file, and prunes backups past maxBackups.
+func (l *Logger) rotate() error {
+	l.file.Close()
+
+	rotated := fmt.Sprintf("%s.%s.gz", l.path, time.Now().Format("20060102T150405"))
+	if err := compressFile(l.path, rotated); err != nil {
+		return err
+	}
+	if err := os.Remove(l.path); err != nil {
+		return err
+	}
+	if err := l.pruneBackups(); err != nil {
+		fmt.Println("Error pruning old log backups:", err)
+	}
+	return l.openCurrent()
+}
+
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+func (l *Logger) pruneBackups() error {
+	matches, err := filepath.Glob(l.path + ".*.gz")
+	if err != nil {
+		return err
+	}
+	if len(matches) <= l.maxBackups {
+		return nil
+	}
+	sort.Strings(matches) // timestamp suffixes sort chronologically
+	for _, old := range matches[:len(matches)-l.maxBackups] {
+		os.Remove(old)
+	}
+	return nil
+}
+
+// Close flushes pending records and waits for the writer goroutine to exit.
+func (l *Logger) Close() error {
+	close(l.records)
+	<-l.done
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RouteLimit is the token-bucket configuration applied to a single route.
+type RouteLimit struct {
+	Rate  rate.Limit
+	Burst int
+}
+
+// visitor pairs a per-IP limiter with the last time it was used, so stale
+// entries can be garbage-collected.
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter is per-IP, per-route, per-method token-bucket middleware. Each
+// (method, route, ip) triple gets its own *rate.Limiter, so a burst against
+// one route or method, or from one attacker, never starves well-behaved
+// traffic elsewhere.
+type RateLimiter struct {
+	mu       sync.Mutex
+	visitors map[string]map[string]*visitor // "method route" -> ip -> visitor
+	routes   map[string]RouteLimit          // "method route" overrides
+	methods  map[string]RouteLimit          // method-only overrides, e.g. stricter POST, looser GET
+	def      RouteLimit
+	ttl      time.Duration
+}
+
+// NewRateLimiter builds a RateLimiter that falls back to defRate/defBurst for
+// any request without a more specific limit set via SetRouteLimit or
+// SetMethodLimit, and starts the background visitor garbage collector.
+func NewRateLimiter(defRate rate.Limit, defBurst int) *RateLimiter {
+	rl := &RateLimiter{
+		visitors: make(map[string]map[string]*visitor),
+		routes:   make(map[string]RouteLimit),
+		methods:  make(map[string]RouteLimit),
+		def:      RouteLimit{Rate: defRate, Burst: defBurst},
+		ttl:      3 * time.Minute,
+	}
+	go rl.cleanupVisitors()
+	return rl
+}
+
+// SetRouteLimit overrides the rate/burst applied to method+route requests,
+// taking precedence over both SetMethodLimit and the default limit.
+func (rl *RateLimiter) SetRouteLimit(method, route string, r rate.Limit, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.routes[rl.key(method, route)] = RouteLimit{Rate: r, Burst: burst}
+}
+
+// SetMethodLimit overrides the rate/burst applied to every request using
+// method, regardless of route, unless a more specific SetRouteLimit applies.
+// method may be a pseudo-method like "WS" for WebSocket upgrade requests,
+// which Middleware distinguishes from a plain GET.
+func (rl *RateLimiter) SetMethodLimit(method string, r rate.Limit, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.methods[method] = RouteLimit{Rate: r, Burst: burst}
+}
+
+func (rl *RateLimiter) key(method, route string) string {
+	return method + " " + route
+}
+
+func (rl *RateLimiter) limitFor(method, route string) RouteLimit {
+	if override, ok := rl.routes[rl.key(method, route)]; ok {
+		return override
+	}
+	if override, ok := rl.methods[method]; ok {
+		return override
+	}
+	return rl.def
+}
+
+func (rl *RateLimiter) getVisitor(method, route, ip string) *visitor {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	key := rl.key(method, route)
+	perRoute, ok := rl.visitors[key]
+	if !ok {
+		perRoute = make(map[string]*visitor)
+		rl.visitors[key] = perRoute
+	}
+
+	v, exists := perRoute[ip]
+	if !exists {
+		limit := rl.limitFor(method, route)
+		v = &visitor{limiter: rate.NewLimiter(limit.Rate, limit.Burst)}
+		perRoute[ip] = v
+	}
+	v.lastSeen = time.Now()
+	return v
+}
+
+// Allow reports whether a request from ip, using method against route, may
+// proceed right now.
+func (rl *RateLimiter) Allow(method, route, ip string) bool {
+	return rl.getVisitor(method, route, ip).limiter.Allow()
+}
+
+// requestMethod returns the key Allow/SetMethodLimit should use for r: the
+// pseudo-method "WS" for WebSocket upgrade requests (so handshakes can be
+// given their own burst allowance), otherwise r.Method.
+func requestMethod(r *http.Request) string {
+	if isWebSocketUpgrade(r) {
+		return "WS"
+	}
+	return r.Method
+}
+
+// Middleware wraps next so every request is checked against the limiter
+// before being dispatched, responding 429 once the bucket is empty.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := getIP(r)
+		if !rl.Allow(requestMethod(r), r.URL.Path, ip) {
+			defender.AddEvent(ip, EventRateViolation)
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cleanupVisitors periodically evicts visitors that haven't been seen within
+// ttl, so a long-running server doesn't accumulate one limiter per attacker
+// IP forever.
+func (rl *RateLimiter) cleanupVisitors() {
+	for {
+		time.Sleep(time.Minute)
+		rl.mu.Lock()
+		for route, perRoute := range rl.visitors {
+			for ip, v := range perRoute {
+				if time.Since(v.lastSeen) > rl.ttl {
+					delete(perRoute, ip)
+				}
+			}
+			if len(perRoute) == 0 {
+				delete(rl.visitors, route)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	rl := NewRateLimiter(rate.Limit(1), 2)
+
+	// Burst of 2 should pass immediately, the third request over the same
+	// bucket should be refused until the bucket refills.
+	if !rl.Allow(http.MethodGet, "/", "203.0.113.1") {
+		t.Fatal("expected first request within burst to be allowed")
+	}
+	if !rl.Allow(http.MethodGet, "/", "203.0.113.1") {
+		t.Fatal("expected second request within burst to be allowed")
+	}
+	if rl.Allow(http.MethodGet, "/", "203.0.113.1") {
+		t.Fatal("expected third request to exceed the burst and be refused")
+	}
+}
+
+func TestRateLimiterPerRouteAndPerIPIsolation(t *testing.T) {
+	rl := NewRateLimiter(rate.Limit(1), 1)
+
+	if !rl.Allow(http.MethodGet, "/a", "203.0.113.1") {
+		t.Fatal("expected first request to /a to be allowed")
+	}
+	if rl.Allow(http.MethodGet, "/a", "203.0.113.1") {
+		t.Fatal("expected second request to /a from the same IP to be refused")
+	}
+
+	// A different route's bucket is independent.
+	if !rl.Allow(http.MethodGet, "/b", "203.0.113.1") {
+		t.Fatal("expected a different route to have its own bucket")
+	}
+
+	// A different IP's bucket on the same route is independent.
+	if !rl.Allow(http.MethodGet, "/a", "203.0.113.2") {
+		t.Fatal("expected a different IP to have its own bucket")
+	}
+}
+
+func TestRateLimiterMethodOverride(t *testing.T) {
+	rl := NewRateLimiter(rate.Limit(1), 1)
+	rl.SetMethodLimit(http.MethodPost, rate.Limit(1), 5)
+
+	for i := 0; i < 5; i++ {
+		if !rl.Allow(http.MethodPost, "/", "203.0.113.1") {
+			t.Fatalf("expected request %d within the POST-specific burst to be allowed", i+1)
+		}
+	}
+	if rl.Allow(http.MethodPost, "/", "203.0.113.1") {
+		t.Fatal("expected request past the POST-specific burst to be refused")
+	}
+
+	// GET on the same route falls back to the default limit, unaffected by
+	// the POST override.
+	if !rl.Allow(http.MethodGet, "/", "203.0.113.1") {
+		t.Fatal("expected GET to use the default limit, independent of the POST override")
+	}
+}
+
+func TestRateLimiterRouteOverrideTakesPrecedenceOverMethod(t *testing.T) {
+	rl := NewRateLimiter(rate.Limit(1), 1)
+	rl.SetMethodLimit(http.MethodGet, rate.Limit(1), 1)
+	rl.SetRouteLimit(http.MethodGet, "/strict", rate.Limit(1), 0)
+
+	if rl.Allow(http.MethodGet, "/strict", "203.0.113.1") {
+		t.Fatal("expected the route-specific zero-burst override to refuse even the first request")
+	}
+}
@@ -1,159 +1,189 @@
 package main
 
 import (
-	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net"
 	"net/http"
-	"os"
-	"sync"
+	"net/netip"
+	"strings"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
+const maxBodySize = 1 << 20 // 1 MiB
+
 var (
-	// IP banlist
-	banlist      = make(map[string]time.Time)
-	banDuration  = 1 * time.Minute // Duration for which an IP is banned
-	requestLimit = 4               // Number of allowed requests per time window
-	timeWindow   = 1 * time.Second // Time window for request limit
-	mu           sync.Mutex        // Mutex to protect shared resources
-	requests     = make(map[string][]time.Time)
+	// limiter is the global token-bucket rate limiter, configured from flags in main().
+	limiter *RateLimiter
+
+	// defender is the global abuse-scoring system that decides bans, configured from flags in main().
+	defender *Defender
+
+	// reqLogger is the global async structured request logger, configured from flags in main().
+	reqLogger *Logger
 )
 
-type request struct {
-	ip   string
-	time time.Time
-	body []byte
-}
+// handler fronts every incoming request, after limiter.Middleware has
+// rate-limited it: it rejects banned IPs regardless of method, then
+// dispatches to the appropriate handling for a WebSocket upgrade, a
+// body-bearing POST (logged), or a plain GET/HEAD (logged). "/" is the
+// only path this demo server serves; anything else is scored as a 404
+// the same as a real backend probed for nonexistent resources would be.
+func handler(w http.ResponseWriter, r *http.Request) {
+	clientIP := getIP(r)
 
-func createLog(req request, filepath string) {
-	file, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Println("Error writing log file:", err)
+	// Check if the IP is banned
+	if defender.IsBanned(clientIP) {
+		http.Error(w, "Forbidden access", http.StatusForbidden)
 		return
 	}
-	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	newLine := fmt.Sprintf("IP:%s | Time:%s | Body:%s\n", req.ip, req.time.Format(time.RFC3339), string(req.body))
-
-	_, err = writer.WriteString(newLine)
-	if err != nil {
-		fmt.Println("Error writing log file:", err)
+	if r.URL.Path != "/" {
+		defender.AddEvent(clientIP, Event404)
+		http.NotFound(w, r)
 		return
 	}
 
-	err = writer.Flush()
-	if err != nil {
-		fmt.Println("Error flushing log write buffer:", err)
+	if isWebSocketUpgrade(r) {
+		handleWebSocketUpgrade(w, r, clientIP)
 		return
 	}
 
-	fmt.Println("Log successful.")
-}
-
-// getIP gets the client's real IP address from the request
-func getIP(r *http.Request) string {
-	// Try to get the IP from the X-Forwarded-For header (useful if the server is behind a proxy)
-	ip := r.Header.Get("X-Forwarded-For")
-	if ip == "" {
-		// If no X-Forwarded-For header, get the IP from RemoteAddr
-		ip, _, _ = net.SplitHostPort(r.RemoteAddr)
+	switch r.Method {
+	case http.MethodPost:
+		handlePost(w, r, clientIP)
+	case http.MethodGet, http.MethodHead:
+		handleSimple(w, r, clientIP)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
-	return ip
 }
 
-// isBanned checks if an IP is in the banlist
-func isBanned(ip string) bool {
-	mu.Lock()
-	defer mu.Unlock()
-	banTime, exists := banlist[ip]
-	if !exists {
-		return false
-	}
-	if time.Now().After(banTime) {
-		delete(banlist, ip)
-		return false
+// handlePost reads and logs the request body, the original behavior of this
+// server before it grew support for other methods.
+func handlePost(w http.ResponseWriter, r *http.Request, clientIP string) {
+	// Read the body of the request, rejecting anything unreasonably large
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			defender.AddEvent(clientIP, EventOversizedBody)
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		defender.AddEvent(clientIP, EventMalformedBody)
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
 	}
-	return true
-}
+	defer r.Body.Close()
 
-// addRequest records a new request from an IP and returns whether it should be banned
-func addRequest(ip string) bool {
-	mu.Lock()
-	defer mu.Unlock()
+	logRequest(r, clientIP, len(body), string(body))
 
-	now := time.Now()
-	requestTimes := requests[ip]
+	// Log the client's IP address and the request body to the terminal
+	fmt.Printf("Received request from %s: %s\n", clientIP, body)
 
-	// Filter out old requests that are outside the time window
-	newRequestTimes := []time.Time{}
-	for _, t := range requestTimes {
-		if now.Sub(t) <= timeWindow {
-			newRequestTimes = append(newRequestTimes, t)
-		}
-	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Request received"))
+}
 
-	// Add the current request time
-	newRequestTimes = append(newRequestTimes, now)
-	requests[ip] = newRequestTimes
+// handleSimple serves GET/HEAD requests, which carry no body to read.
+func handleSimple(w http.ResponseWriter, r *http.Request, clientIP string) {
+	logRequest(r, clientIP, 0, "")
 
-	// Check if the number of requests exceeds the limit
-	if len(newRequestTimes) > requestLimit {
-		banlist[ip] = now.Add(banDuration)
-		delete(requests, ip) // Clear the request history for this IP
-		return true
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write([]byte("Request received"))
 	}
-	return false
 }
 
-// handler handles incoming HTTP POST requests
-func handler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Get the client's IP address
-	clientIP := getIP(r)
+// logRequest records clientIP's request in both the abuse tracker and the
+// structured request log.
+func logRequest(r *http.Request, clientIP string, bodySize int, body string) {
+	defender.RecordRequest(clientIP, time.Now())
+
+	reqLogger.Log(LogRecord{
+		IP:        clientIP,
+		Timestamp: time.Now(),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		BodySize:  bodySize,
+		UserAgent: r.UserAgent(),
+		Score:     defender.GetScore(clientIP),
+		Banned:    false,
+		Body:      body,
+	})
+}
 
-	// Check if the IP is banned
-	if isBanned(clientIP) {
-		http.Error(w, "Forbidden access", http.StatusForbidden)
-		return
+func main() {
+	rateFlag := flag.Float64("rate", 10, "sustained POST requests per second allowed per IP")
+	burstFlag := flag.Int("burst", 20, "burst of POST requests allowed per IP above the sustained rate")
+	getRate := flag.Float64("get-rate", 20, "sustained GET/HEAD requests per second allowed per IP")
+	getBurst := flag.Int("get-burst", 40, "burst of GET/HEAD requests allowed per IP above the sustained rate")
+	wsRate := flag.Float64("ws-rate", 1, "sustained WebSocket handshakes per second allowed per IP")
+	wsBurst := flag.Int("ws-burst", 5, "burst of WebSocket handshakes allowed per IP above the sustained rate")
+	allowedOriginsFlag := flag.String("allowed-origins", "", "comma-separated Origin values allowed to open a WebSocket connection")
+	adminAddr := flag.String("admin-addr", ":9090", "address the admin API listens on")
+	adminToken := flag.String("admin-token", "", "bearer token required to call the admin API")
+	storeKind := flag.String("store", "memory", "backend for ban/score state: memory, bolt, or redis")
+	storeDSN := flag.String("store-dsn", "./defender.db", "store location: a file path for bolt, or host:port for redis")
+	trustedProxiesFlag := flag.String("trusted-proxies", "", "comma-separated CIDRs of reverse proxies allowed to set X-Forwarded-For")
+	logPath := flag.String("log-path", "./log.txt", "path to the structured request log")
+	logMaxSizeMB := flag.Int64("log-max-size-mb", 100, "size in MiB at which the request log is rotated")
+	logMaxBackups := flag.Int("log-max-backups", 5, "number of compressed rotated log files to keep")
+	logMaxBodyBytes := flag.Int("log-max-body-bytes", 2<<10, "request bodies larger than this are redacted in the log")
+	flag.Parse()
+
+	var err error
+	reqLogger, err = NewLogger(*logPath, *logMaxSizeMB<<20, *logMaxBackups, *logMaxBodyBytes)
+	if err != nil {
+		log.Fatalf("Failed to initialize request logger: %v", err)
 	}
 
-	// Add the request to the tracking system and check if the IP should be banned
-	if addRequest(clientIP) {
-		http.Error(w, "Too many requests", http.StatusTooManyRequests)
-		return
+	for _, cidr := range strings.Split(*trustedProxiesFlag, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			log.Fatalf("Invalid --trusted-proxies entry %q: %v", cidr, err)
+		}
+		trustedProxies = append(trustedProxies, prefix)
 	}
 
-	// Read the body of the request
-	body, err := ioutil.ReadAll(r.Body)
+	store, err := newStore(*storeKind, *storeDSN)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
-		return
+		log.Fatalf("Failed to initialize %s store: %v", *storeKind, err)
+	}
+	defender = NewDefender(store)
+
+	limiter = NewRateLimiter(rate.Limit(*rateFlag), *burstFlag)
+	limiter.SetMethodLimit(http.MethodPost, rate.Limit(*rateFlag), *burstFlag)
+	limiter.SetMethodLimit(http.MethodGet, rate.Limit(*getRate), *getBurst)
+	limiter.SetMethodLimit(http.MethodHead, rate.Limit(*getRate), *getBurst)
+	limiter.SetMethodLimit("WS", rate.Limit(*wsRate), *wsBurst)
+
+	for _, origin := range strings.Split(*allowedOriginsFlag, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin != "" {
+			AllowedOrigins = append(AllowedOrigins, origin)
+		}
 	}
-	defer r.Body.Close()
-
-	// Collect request data for logs and write it to file
-	logFilePath := "./log.txt"
-	requestData := request{ip: clientIP, time: time.Now(), body: body}
-	createLog(requestData, logFilePath)
-
-	// Log the client's IP address and the request body to the terminal
-	fmt.Printf("Received request from %s: %s\n", clientIP, body)
 
-	// Respond to the client
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Request received"))
-}
+	if *adminToken == "" {
+		fmt.Println("Warning: --admin-token is empty; the admin API will reject every request")
+	}
+	admin := NewAdminServer(defender, *adminToken)
+	go func() {
+		log.Fatal(http.ListenAndServe(*adminAddr, admin))
+	}()
 
-func main() {
-	http.HandleFunc("/", handler)
+	http.Handle("/", limiter.Middleware(http.HandlerFunc(handler)))
 
 	fmt.Println("Server is listening on port 8080...")
 	log.Fatal(http.ListenAndServe(":8080", nil))
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerScoresUnknownPathAs404(t *testing.T) {
+	savedDefender := defender
+	defer func() { defender = savedDefender }()
+	defender = NewDefender(NewMemoryStore())
+
+	req := httptest.NewRequest("GET", "/no-such-resource", nil)
+	rec := httptest.NewRecorder()
+
+	handler(rec, req)
+
+	if rec.Code != 404 {
+		t.Errorf("status = %d, want 404 for an unknown path", rec.Code)
+	}
+	if score := defender.GetScore(getIP(req)); score == 0 {
+		t.Error("expected an unknown path to add to the requester's abuse score via Event404")
+	}
+}
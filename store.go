@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Store persists the abuse-tracking state the Defender needs, so it survives
+// process restarts and can optionally be shared by a fleet of servers behind
+// a load balancer. Implementations must be safe for concurrent use.
+type Store interface {
+	// IsBanned reports whether ip currently has an unexpired ban recorded.
+	IsBanned(ip string) (bool, error)
+	// Ban records that ip is banned until expiry.
+	Ban(ip string, expiry time.Time) error
+	// Unban clears any ban recorded for ip.
+	Unban(ip string) error
+	// BannedIPs returns every IP with an unexpired ban, keyed to its expiry.
+	BannedIPs() (map[string]time.Time, error)
+	// BanExpiry returns the expiry time of ip's ban, if any.
+	BanExpiry(ip string) (time.Time, bool, error)
+
+	// RecordRequest appends t to ip's recent request history.
+	RecordRequest(ip string, t time.Time) error
+	// RecentRequests returns ip's recent request history, oldest first.
+	RecentRequests(ip string) ([]time.Time, error)
+
+	// AddScore adds delta to ip's abuse score and returns the new total.
+	AddScore(ip string, delta int) (int, error)
+	// SetScore overwrites ip's abuse score, e.g. after a ban resets it.
+	SetScore(ip string, score int) error
+	// GetScore returns ip's current abuse score.
+	GetScore(ip string) (int, error)
+
+	// IncrementOffenses increments and returns ip's offense count, used to
+	// pick how far along the escalating ban schedule ip has progressed.
+	IncrementOffenses(ip string) (int, error)
+	// GetOffenses returns ip's current offense count.
+	GetOffenses(ip string) (int, error)
+
+	// TrackedIPs returns every IP the store currently holds state for, so the
+	// Defender's decay loop can sweep them.
+	TrackedIPs() ([]string, error)
+	// Forget discards ip's record entirely. Used by the decay loop once a
+	// host's score has decayed to zero and it has no active ban or offense
+	// history left worth keeping, so a store doesn't accumulate one record
+	// per IP ever seen forever.
+	Forget(ip string) error
+
+	// Close releases any resources (file handles, connections) held by the store.
+	Close() error
+}
+
+// newStore builds the Store selected by --store, using dsn as its file path
+// (bolt) or address (redis).
+func newStore(kind, dsn string) (Store, error) {
+	switch kind {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "bolt":
+		return NewBoltStore(dsn)
+	case "redis":
+		return NewRedisStore(dsn)
+	default:
+		return nil, fmt.Errorf("unknown store kind %q (want memory, bolt, or redis)", kind)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("defender")
+
+// boltRecord is the JSON encoding of a single IP's state inside BoltDB.
+type boltRecord struct {
+	Score    int         `json:"score"`
+	Offenses int         `json:"offenses"`
+	BanUntil time.Time   `json:"ban_until"`
+	Recent   []time.Time `json:"recent"`
+}
+
+// BoltStore is an on-disk Store backed by a single BoltDB file, so bans and
+// scores survive a process restart without requiring an external database.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (creating if necessary) a BoltDB file at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) get(tx *bolt.Tx, ip string) (boltRecord, bool) {
+	raw := tx.Bucket(boltBucket).Get([]byte(ip))
+	if raw == nil {
+		return boltRecord{}, false
+	}
+	var rec boltRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return boltRecord{}, false
+	}
+	return rec, true
+}
+
+func (s *BoltStore) put(tx *bolt.Tx, ip string, rec boltRecord) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltBucket).Put([]byte(ip), raw)
+}
+
+func (s *BoltStore) update(ip string, fn func(rec *boltRecord)) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		rec, _ := s.get(tx, ip)
+		fn(&rec)
+		return s.put(tx, ip, rec)
+	})
+}
+
+func (s *BoltStore) IsBanned(ip string) (bool, error) {
+	_, banned, err := s.BanExpiry(ip)
+	return banned, err
+}
+
+func (s *BoltStore) Ban(ip string, expiry time.Time) error {
+	return s.update(ip, func(rec *boltRecord) { rec.BanUntil = expiry })
+}
+
+func (s *BoltStore) Unban(ip string) error {
+	return s.update(ip, func(rec *boltRecord) {
+		rec.BanUntil = time.Time{}
+		rec.Score = 0
+	})
+}
+
+func (s *BoltStore) BannedIPs() (map[string]time.Time, error) {
+	banned := make(map[string]time.Time)
+	now := time.Now()
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+			var rec boltRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return nil
+			}
+			if !rec.BanUntil.IsZero() && now.Before(rec.BanUntil) {
+				banned[string(k)] = rec.BanUntil
+			}
+			return nil
+		})
+	})
+	return banned, err
+}
+
+func (s *BoltStore) BanExpiry(ip string) (time.Time, bool, error) {
+	var rec boltRecord
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		rec, found = s.get(tx, ip)
+		return nil
+	})
+	if err != nil || !found || rec.BanUntil.IsZero() || time.Now().After(rec.BanUntil) {
+		return time.Time{}, false, err
+	}
+	return rec.BanUntil, true, nil
+}
+
+func (s *BoltStore) RecordRequest(ip string, t time.Time) error {
+	return s.update(ip, func(rec *boltRecord) {
+		rec.Recent = append(rec.Recent, t)
+		if len(rec.Recent) > maxRecentRequests {
+			rec.Recent = rec.Recent[len(rec.Recent)-maxRecentRequests:]
+		}
+	})
+}
+
+func (s *BoltStore) RecentRequests(ip string) ([]time.Time, error) {
+	var rec boltRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		rec, _ = s.get(tx, ip)
+		return nil
+	})
+	return rec.Recent, err
+}
+
+func (s *BoltStore) AddScore(ip string, delta int) (int, error) {
+	var score int
+	err := s.update(ip, func(rec *boltRecord) {
+		rec.Score += delta
+		score = rec.Score
+	})
+	return score, err
+}
+
+func (s *BoltStore) SetScore(ip string, score int) error {
+	return s.update(ip, func(rec *boltRecord) { rec.Score = score })
+}
+
+func (s *BoltStore) GetScore(ip string) (int, error) {
+	var rec boltRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		rec, _ = s.get(tx, ip)
+		return nil
+	})
+	return rec.Score, err
+}
+
+func (s *BoltStore) IncrementOffenses(ip string) (int, error) {
+	var offenses int
+	err := s.update(ip, func(rec *boltRecord) {
+		rec.Offenses++
+		offenses = rec.Offenses
+	})
+	return offenses, err
+}
+
+func (s *BoltStore) GetOffenses(ip string) (int, error) {
+	var rec boltRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		rec, _ = s.get(tx, ip)
+		return nil
+	})
+	return rec.Offenses, err
+}
+
+func (s *BoltStore) TrackedIPs() ([]string, error) {
+	var ips []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, _ []byte) error {
+			ips = append(ips, string(k))
+			return nil
+		})
+	})
+	return ips, err
+}
+
+func (s *BoltStore) Forget(ip string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(ip))
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
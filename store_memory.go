@@ -0,0 +1,164 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// memRecord is the state MemoryStore keeps for a single IP.
+type memRecord struct {
+	score    int
+	offenses int
+	banUntil time.Time
+	recent   []time.Time
+}
+
+// MemoryStore is the default Store: a process-local map with no persistence.
+// It's the right choice for development and for single-node deployments that
+// don't need bans to survive a restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*memRecord
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*memRecord)}
+}
+
+func (s *MemoryStore) get(ip string) *memRecord {
+	r, ok := s.records[ip]
+	if !ok {
+		r = &memRecord{}
+		s.records[ip] = r
+	}
+	return r
+}
+
+func (s *MemoryStore) IsBanned(ip string) (bool, error) {
+	_, banned, err := s.BanExpiry(ip)
+	return banned, err
+}
+
+func (s *MemoryStore) Ban(ip string, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(ip).banUntil = expiry
+	return nil
+}
+
+func (s *MemoryStore) Unban(ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.records[ip]; ok {
+		r.banUntil = time.Time{}
+		r.score = 0
+	}
+	return nil
+}
+
+func (s *MemoryStore) BannedIPs() (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	banned := make(map[string]time.Time)
+	for ip, r := range s.records {
+		if !r.banUntil.IsZero() && now.Before(r.banUntil) {
+			banned[ip] = r.banUntil
+		}
+	}
+	return banned, nil
+}
+
+func (s *MemoryStore) BanExpiry(ip string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[ip]
+	if !ok || r.banUntil.IsZero() || time.Now().After(r.banUntil) {
+		return time.Time{}, false, nil
+	}
+	return r.banUntil, true, nil
+}
+
+func (s *MemoryStore) RecordRequest(ip string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.get(ip)
+	r.recent = append(r.recent, t)
+	if len(r.recent) > maxRecentRequests {
+		r.recent = r.recent[len(r.recent)-maxRecentRequests:]
+	}
+	return nil
+}
+
+func (s *MemoryStore) RecentRequests(ip string) ([]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[ip]
+	if !ok {
+		return nil, nil
+	}
+	out := make([]time.Time, len(r.recent))
+	copy(out, r.recent)
+	return out, nil
+}
+
+func (s *MemoryStore) AddScore(ip string, delta int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.get(ip)
+	r.score += delta
+	return r.score, nil
+}
+
+func (s *MemoryStore) SetScore(ip string, score int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(ip).score = score
+	return nil
+}
+
+func (s *MemoryStore) GetScore(ip string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.records[ip]; ok {
+		return r.score, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) IncrementOffenses(ip string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.get(ip)
+	r.offenses++
+	return r.offenses, nil
+}
+
+func (s *MemoryStore) GetOffenses(ip string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.records[ip]; ok {
+		return r.offenses, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) TrackedIPs() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ips := make([]string, 0, len(s.records))
+	for ip := range s.records {
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+func (s *MemoryStore) Forget(ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, ip)
+	return nil
+}
+
+func (s *MemoryStore) Close() error { return nil }
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "ddos:"
+
+// RedisStore is a Store backed by Redis, letting a fleet of servers behind a
+// load balancer share one view of abusive IPs: a ban recorded by the node
+// that observed the attack is immediately visible to every other node.
+type RedisStore struct {
+	rdb *redis.Client
+}
+
+// NewRedisStore connects to the Redis instance at addr.
+func NewRedisStore(addr string) (*RedisStore, error) {
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		return nil, err
+	}
+	return &RedisStore{rdb: rdb}, nil
+}
+
+func (s *RedisStore) hostKey(ip string) string   { return redisKeyPrefix + "host:" + ip }
+func (s *RedisStore) recentKey(ip string) string { return redisKeyPrefix + "recent:" + ip }
+func (s *RedisStore) bannedKey() string          { return redisKeyPrefix + "banned" }
+
+func (s *RedisStore) IsBanned(ip string) (bool, error) {
+	_, banned, err := s.BanExpiry(ip)
+	return banned, err
+}
+
+func (s *RedisStore) Ban(ip string, expiry time.Time) error {
+	ctx := context.Background()
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, s.hostKey(ip), "ban_until", expiry.UnixNano())
+	pipe.ZAdd(ctx, s.bannedKey(), redis.Z{Score: float64(expiry.Unix()), Member: ip})
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) Unban(ip string) error {
+	ctx := context.Background()
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, s.hostKey(ip), "ban_until", 0, "score", 0)
+	pipe.ZRem(ctx, s.bannedKey(), ip)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) BannedIPs() (map[string]time.Time, error) {
+	ctx := context.Background()
+	now := float64(time.Now().Unix())
+	ips, err := s.rdb.ZRangeByScore(ctx, s.bannedKey(), &redis.ZRangeBy{Min: strconv.FormatFloat(now, 'f', 0, 64), Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+	banned := make(map[string]time.Time, len(ips))
+	for _, ip := range ips {
+		if expiry, ok, err := s.BanExpiry(ip); err == nil && ok {
+			banned[ip] = expiry
+		}
+	}
+	return banned, nil
+}
+
+func (s *RedisStore) BanExpiry(ip string) (time.Time, bool, error) {
+	ctx := context.Background()
+	raw, err := s.rdb.HGet(ctx, s.hostKey(ip), "ban_until").Result()
+	if err == redis.Nil {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	nanos, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || nanos == 0 {
+		return time.Time{}, false, nil
+	}
+	expiry := time.Unix(0, nanos)
+	if time.Now().After(expiry) {
+		return time.Time{}, false, nil
+	}
+	return expiry, true, nil
+}
+
+func (s *RedisStore) RecordRequest(ip string, t time.Time) error {
+	ctx := context.Background()
+	key := s.recentKey(ip)
+	pipe := s.rdb.TxPipeline()
+	// Make sure the host hash exists, so TrackedIPs (which scans host keys)
+	// returns this IP and the decay loop can eventually forget it.
+	pipe.HSetNX(ctx, s.hostKey(ip), "score", 0)
+	pipe.RPush(ctx, key, t.UnixNano())
+	pipe.LTrim(ctx, key, -maxRecentRequests, -1)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) RecentRequests(ip string) ([]time.Time, error) {
+	ctx := context.Background()
+	raw, err := s.rdb.LRange(ctx, s.recentKey(ip), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]time.Time, 0, len(raw))
+	for _, v := range raw {
+		nanos, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		out = append(out, time.Unix(0, nanos))
+	}
+	return out, nil
+}
+
+func (s *RedisStore) AddScore(ip string, delta int) (int, error) {
+	ctx := context.Background()
+	score, err := s.rdb.HIncrBy(ctx, s.hostKey(ip), "score", int64(delta)).Result()
+	return int(score), err
+}
+
+func (s *RedisStore) SetScore(ip string, score int) error {
+	ctx := context.Background()
+	return s.rdb.HSet(ctx, s.hostKey(ip), "score", score).Err()
+}
+
+func (s *RedisStore) GetScore(ip string) (int, error) {
+	ctx := context.Background()
+	v, err := s.rdb.HGet(ctx, s.hostKey(ip), "score").Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return v, err
+}
+
+func (s *RedisStore) IncrementOffenses(ip string) (int, error) {
+	ctx := context.Background()
+	v, err := s.rdb.HIncrBy(ctx, s.hostKey(ip), "offenses", 1).Result()
+	return int(v), err
+}
+
+func (s *RedisStore) GetOffenses(ip string) (int, error) {
+	ctx := context.Background()
+	v, err := s.rdb.HGet(ctx, s.hostKey(ip), "offenses").Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return v, err
+}
+
+// TrackedIPs walks the keyspace with SCAN rather than KEYS: KEYS blocks
+// Redis for the duration of the scan, and this is called every
+// scoreDecayInterval by Defender.decayLoop, so a fleet sharing one Redis
+// instance under sustained attack would otherwise see it stall periodically.
+func (s *RedisStore) TrackedIPs() ([]string, error) {
+	ctx := context.Background()
+	prefix := redisKeyPrefix + "host:"
+	var ips []string
+	var cursor uint64
+	for {
+		keys, next, err := s.rdb.Scan(ctx, cursor, prefix+"*", 0).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			ips = append(ips, k[len(prefix):])
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	return ips, nil
+}
+
+func (s *RedisStore) Forget(ip string) error {
+	ctx := context.Background()
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, s.hostKey(ip), s.recentKey(ip))
+	pipe.ZRem(ctx, s.bannedKey(), ip)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) Close() error {
+	return s.rdb.Close()
+}
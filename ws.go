@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// AllowedOrigins lists the Origin header values permitted to open a
+// WebSocket connection through this server, configured from
+// --allowed-origins in main(). An empty list allows none: WebSocket
+// upgrades are refused until an operator opts in, since an open CheckOrigin
+// is exactly what lets third-party JavaScript co-opt visitors' browsers into
+// an amplification DDoS against the backend.
+var AllowedOrigins []string
+
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return false
+		}
+		for _, allowed := range AllowedOrigins {
+			if allowed == origin {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// isWebSocketUpgrade reports whether r is a WebSocket handshake request.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return websocket.IsWebSocketUpgrade(r)
+}
+
+// handleWebSocketUpgrade completes a WebSocket handshake - rejecting it if
+// wsUpgrader.CheckOrigin doesn't approve the Origin header - and then runs a
+// minimal echo loop. A real deployment would hand the connection off to
+// whatever backend this server is protecting; this proves a legitimate
+// WebSocket client makes it through the protection layer intact.
+//
+// The handshake itself only burns one "WS" token; without further checks an
+// attacker could hold the connection open and flood it with unlimited,
+// unbounded-size frames. So every subsequent message is capped in size and
+// spent against the same "WS" bucket as the handshake, and a client that
+// gets banned mid-connection (or outruns its rate limit) is disconnected.
+func handleWebSocketUpgrade(w http.ResponseWriter, r *http.Request, clientIP string) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Println("WebSocket upgrade rejected for", clientIP, ":", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxBodySize)
+
+	for {
+		if defender.IsBanned(clientIP) {
+			return
+		}
+		if !limiter.Allow("WS", r.URL.Path, clientIP) {
+			defender.AddEvent(clientIP, EventRateViolation)
+			return
+		}
+
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := conn.WriteMessage(messageType, message); err != nil {
+			return
+		}
+	}
+}